@@ -2,99 +2,168 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	pb "orcanet/market"
 
+	"github.com/ipfs/go-cid"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-libp2p/core/record"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
 )
 
-// printRoutingTable prints the current state of the DHT's routing table to the console.
-// This function is useful for debugging and monitoring the local view of the network topology.
-//
-// Parameters:
-// - dht: A pointer to the dht.IpfsDHT instance whose routing table is to be printed.
-//
-// Returns: None.
-func printRoutingTable(dht *dht.IpfsDHT) {
-	for _, peer := range dht.RoutingTable().ListPeers() {
-		fmt.Println("Peer ID:", peer)
+// fileRecordTTL bounds how long a signed MarketFileRecord is considered
+// fresh. It is twice MarketService's reprovideInterval, which refreshes
+// both the provider record and the signed attestation on the same cadence.
+const fileRecordTTL = 24 * time.Hour
+
+// findProvidersTimeout bounds how long checkHolders will wait on the DHT
+// walk before returning whatever holders it has collected so far.
+const findProvidersTimeout = 30 * time.Second
+
+// fileCID wraps a hex-encoded file hash as a raw, identity-hashed CID so it
+// can be used as a Kademlia provider-record key. We deliberately don't
+// re-hash the bytes: the file hash is already the identifier callers care
+// about, so an identity multihash preserves it verbatim inside the CID.
+func fileCID(fileHash string) (cid.Cid, error) {
+	raw, err := hex.DecodeString(fileHash)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid file hash %q: %v", fileHash, err)
+	}
+
+	mh, err := multihash.Encode(raw, multihash.IDENTITY)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to build multihash for file hash %s: %v", fileHash, err)
 	}
+
+	return cid.NewCidV1(cid.Raw, mh), nil
 }
 
-// registerFile registers a file in the DHT, indicating that the local user holds a specific file.
-// This operation makes the file discoverable to other peers searching for it through the DHT.
+// registerFile announces the local peer as a holder of fileHash. It both
+// puts a provider record into the DHT, so many peers can register as
+// holders of the same file without clobbering each other, and puts a
+// signed MarketFileRecord under marketFileRecordKey(fileHash, selfPeerID)
+// attesting to this peer's addresses; MarketValidator rejects forged or
+// expired versions of that record. Callers that want fileHash
+// re-announced on a reprovide ticker or address change should go through
+// MarketService.RegisterFile, which owns that registry; this function
+// itself is stateless.
 //
 // Parameters:
 // - ctx: A context.Context for controlling the function's execution lifetime.
-// - dht: A pointer to the dht.IpfsDHT used for the registration.
-// - req: A *pb.RegisterFileRequest containing the user's information and the file hash to register.
+// - d: A pointer to the dht.IpfsDHT used for the registration.
+// - priv: The host's private key, used to sign the MarketFileRecord.
+// - fileHash: The hex-encoded hash of the file being registered.
+// - addrs: The local peer's addresses to advertise as holding the file.
 //
 // Returns: An error if the registration fails, or nil on success.
-func registerFile(ctx context.Context, dht *dht.IpfsDHT, fileHash string, envelope *record.Envelope) error {
-	key := fmt.Sprintf("/market/file/%s", fileHash)
+func registerFile(ctx context.Context, d *dht.IpfsDHT, priv crypto.PrivKey, fileHash string, addrs []multiaddr.Multiaddr) error {
+	c, err := fileCID(fileHash)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Provide(ctx, c, true); err != nil {
+		return fmt.Errorf("failed to provide file hash %s: %v", fileHash, err)
+	}
+
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to derive peer id from private key: %v", err)
+	}
+
+	envelope, err := sealFileRecord(priv, fileHash, addrs, fileRecordTTL, uint64(time.Now().UnixNano()))
+	if err != nil {
+		return fmt.Errorf("failed to seal MarketFileRecord for file hash %s: %v", fileHash, err)
+	}
 
-	// Serialize the envelope containing the PeerRecord
 	data, err := envelope.Marshal()
 	if err != nil {
-		return fmt.Errorf("failed to marshal PeerRecord envelope: %v", err)
+		return fmt.Errorf("failed to marshal MarketFileRecord envelope: %v", err)
 	}
 
-	// Store the serialized data in the DHT
-	if err := dht.PutValue(ctx, key, data); err != nil {
-		return fmt.Errorf("failed to put value in the DHT for file hash %s: %v", fileHash, err)
+	if err := d.PutValue(ctx, marketFileRecordKey(fileHash, pid), data); err != nil {
+		return fmt.Errorf("failed to put MarketFileRecord for file hash %s: %v", fileHash, err)
 	}
 
 	fmt.Printf("Successfully registered file with hash %s\n", fileHash)
 	return nil
 }
 
-// checkHolders retrieves a list of users holding a specific file by querying the DHT.
-// This function is part of the file discovery process, allowing peers to locate others
-// that have the file they are looking for.
+// checkHolders resolves every holder of a file hash. It first tries to
+// originate a query over the /orcanet/market/holders/1.0.0 protocol (see
+// path.go) so the caller gets back a signed provenance path alongside the
+// holders; if that relayed query fails for any reason (e.g. there's no peer
+// to relay through on a freshly-bootstrapped node with an empty routing
+// table), it falls back to checkHoldersLocal, which returns the same
+// holders with no path.
 //
 // Parameters:
 // - ctx: A context.Context for controlling the function's execution lifetime.
-// - dht: A pointer to the dht.IpfsDHT used for the query.
+// - h: The local host, used to open the holders-protocol stream.
+// - d: A pointer to the dht.IpfsDHT used for the query.
 // - req: A *pb.CheckHoldersRequest containing the file hash to search for.
+// - limit: The maximum number of holders to collect before returning, when falling back to a local query.
 //
-// Returns: A *pb.HoldersResponse containing the list of Users holding the file, and an error if the query fails.
-func checkHolders(ctx context.Context, dht *dht.IpfsDHT, req *pb.CheckHoldersRequest) (*pb.HoldersResponse, error) {
-	key := fmt.Sprintf("/market/file/%s", req.FileHash)
-
-	// Retrieve the serialized envelope from the DHT
-	envelopeBytes, err := dht.GetValue(ctx, key)
-	if err != nil {
-		return nil, fmt.Errorf("error searching for file %s: %w", req.FileHash, err)
+// Returns: A *pb.HoldersResponse containing every corroborated holder observed, and an error if the query fails.
+func checkHolders(ctx context.Context, h host.Host, d *dht.IpfsDHT, req *pb.CheckHoldersRequest, limit int) (*pb.HoldersResponse, error) {
+	if resp, err := originateHolderPathQuery(ctx, h, d, req.FileHash); err == nil {
+		return resp, nil
 	}
+	return checkHoldersLocal(ctx, d, req, limit)
+}
 
-	// Deserialize the envelope
-	envelope, err := record.UnmarshalEnvelope(envelopeBytes)
+// checkHoldersLocal queries the DHT's provider-record subsystem for every
+// peer that has registered as a holder of a file, up to limit results or
+// findProvidersTimeout, whichever comes first. Each provider hit is
+// corroborated against the signed MarketFileRecord that peer should have
+// put under marketFileRecordKey; hits with no valid record are dropped, so
+// a peer that announces itself as a provider without ever registering an
+// authentic, unexpired attestation can't poison the response.
+func checkHoldersLocal(ctx context.Context, d *dht.IpfsDHT, req *pb.CheckHoldersRequest, limit int) (*pb.HoldersResponse, error) {
+	c, err := fileCID(req.FileHash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+		return nil, err
 	}
 
-	// Assuming the envelope payload is a PeerRecord, we now extract it
-	// Note: This step may vary depending on the actual payload type.
-	var peerRec peer.PeerRecord
-	if err := peerRec.UnmarshalRecord(envelope.RawPayload); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal peer record from envelope payload: %w", err)
-	}
+	findCtx, cancel := context.WithTimeout(ctx, findProvidersTimeout)
+	defer cancel()
+
+	holders := make([]*pb.PeerInfo, 0, limit)
+	for addrInfo := range d.FindProvidersAsync(findCtx, c, limit) {
+		rec, err := corroborateHolder(findCtx, d, req.FileHash, addrInfo.ID)
+		if err != nil {
+			fmt.Printf("dropping uncorroborated holder %s for file hash %s: %v\n", addrInfo.ID, req.FileHash, err)
+			continue
+		}
 
-	// Convert the PeerRecord to the protobuf response format
-	// This example is simplified; adjust based on your actual protobuf structure
-	holders := []*pb.PeerInfo{
-		// Populate the PeerInfo based on peerRec
-		{PeerId: peerRec.PeerID.String()},
-		// Include multiaddresses if your pb.PeerInfo structure supports them
+		holders = append(holders, &pb.PeerInfo{
+			PeerId: rec.PeerID.String(),
+			Addrs:  convertAddrsToStrings(addrInfo.Addrs),
+		})
 	}
 
 	return &pb.HoldersResponse{Holders: holders}, nil
 }
 
+// printRoutingTable prints the current state of the DHT's routing table to the console.
+// This function is useful for debugging and monitoring the local view of the network topology.
+//
+// Parameters:
+// - dht: A pointer to the dht.IpfsDHT instance whose routing table is to be printed.
+//
+// Returns: None.
+func printRoutingTable(dht *dht.IpfsDHT) {
+	for _, peer := range dht.RoutingTable().ListPeers() {
+		fmt.Println("Peer ID:", peer)
+	}
+}
+
 // Helper function to convert multiaddresses to strings
 func convertAddrsToStrings(addrs []multiaddr.Multiaddr) []string {
 	addrStrs := make([]string, len(addrs))
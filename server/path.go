@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "orcanet/market"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-msgio/protoio"
+)
+
+// originateHolderPathQuery is the client-side entry point for the
+// /orcanet/market/holders/1.0.0 protocol: it finds the peers closest to
+// the file's key in the same keyspace Provide/FindProvidersAsync use, and
+// opens the first hop of a holder lookup against the closest one that
+// isn't the local peer itself. checkHolders falls back to a local-only
+// query when this returns an error, e.g. on a node with no peers yet.
+func originateHolderPathQuery(ctx context.Context, h host.Host, d *dht.IpfsDHT, fileHash string) (*pb.HoldersResponse, error) {
+	c, err := fileCID(fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetClosestPeers keys its search the same way Provide/FindProvidersAsync
+	// do: by the CID's multihash, not the raw hex file hash string.
+	closest, err := d.GetClosestPeers(ctx, string(c.Hash()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find closest peers for %s: %w", fileHash, err)
+	}
+
+	var next peer.ID
+	for _, p := range closest {
+		if p != h.ID() {
+			next = p
+			break
+		}
+	}
+	if next == "" {
+		return nil, errors.New("no peer available to originate a holder path query")
+	}
+
+	stream, err := h.NewStream(ctx, next, holdersProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holders stream to %s: %w", next, err)
+	}
+	defer stream.Close()
+
+	writer := protoio.NewDelimitedWriter(stream)
+	query := &pb.HolderPathQuery{FileHash: fileHash, DeadlineUnixNano: holderPathDeadline(ctx).UnixNano()}
+	if err := writer.WriteMsg(query); err != nil {
+		return nil, fmt.Errorf("failed to send holder query to %s: %w", next, err)
+	}
+
+	reader := protoio.NewDelimitedReader(stream, network.MessageSizeMax)
+	var resp pb.HoldersResponse
+	if err := reader.ReadMsg(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read holder response from %s: %w", next, err)
+	}
+	return &resp, nil
+}
+
+// holdersProtocolID identifies the thin protocol that wraps a DHT walk for
+// checkHolders so each hop can append a signed PathElement. go-libp2p-kad-dht
+// has no per-hop hook of its own, so this layers on top of it: every hop
+// does a GetClosestPeers, forwards the query to the next hop over this
+// protocol, signs the accumulated path, and returns it upward.
+const holdersProtocolID = "/orcanet/market/holders/1.0.0"
+
+// holderPathMaxHops bounds how many peers a single holder lookup may be
+// relayed through, so a misbehaving or looping chain of peers can't keep a
+// query (and its caller) alive indefinitely.
+const holderPathMaxHops = 16
+
+// holderPathDeadline returns the absolute deadline to stamp onto an
+// outgoing HolderPathQuery: ctx's own deadline if it has one, otherwise
+// findProvidersTimeout from now. Every hop derives its context from this
+// same instant instead of starting a fresh findProvidersTimeout of its
+// own, so the original caller's budget bounds the whole relay chain.
+func holderPathDeadline(ctx context.Context) time.Time {
+	if dl, ok := ctx.Deadline(); ok {
+		return dl
+	}
+	return time.Now().Add(findProvidersTimeout)
+}
+
+// pathElementSigningBytes is the canonical byte form of a PathElement's
+// signed fields. Peer IDs are base58/base32 text that can't contain '>' or
+// '@', so this plain delimiter scheme is unambiguous.
+func pathElementSigningBytes(predecessor, successor peer.ID, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("%s>%s@%d", predecessor, successor, timestamp))
+}
+
+// signPathElement builds and signs a PathElement attesting that priv's peer
+// forwarded a holder lookup on to successor.
+func signPathElement(priv crypto.PrivKey, successor peer.ID, timestamp int64) (*pb.PathElement, error) {
+	predecessor, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive peer id from private key: %w", err)
+	}
+
+	sig, err := priv.Sign(pathElementSigningBytes(predecessor, successor, timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign path element: %w", err)
+	}
+
+	return &pb.PathElement{
+		PredecessorPeerId: predecessor.String(),
+		SuccessorPeerId:   successor.String(),
+		Timestamp:         timestamp,
+		Signature:         sig,
+	}, nil
+}
+
+// VerifyHolderPath walks a holder lookup's query path and checks that it's
+// an unbroken, correctly-ordered, validly-signed chain from originPeer to
+// terminalPeer. pubKeyOf resolves a peer's public key, typically from the
+// host's peerstore (populated by identify) or, failing that, from the
+// envelope embedded in that peer's provider record.
+func VerifyHolderPath(path []*pb.PathElement, originPeer, terminalPeer peer.ID, pubKeyOf func(peer.ID) (crypto.PubKey, error)) error {
+	if len(path) == 0 {
+		return errors.New("holder path is empty")
+	}
+
+	expectedPredecessor := originPeer
+	var lastTimestamp int64
+
+	for i, elem := range path {
+		predecessor, err := peer.Decode(elem.PredecessorPeerId)
+		if err != nil {
+			return fmt.Errorf("path element %d: invalid predecessor peer id: %w", i, err)
+		}
+		successor, err := peer.Decode(elem.SuccessorPeerId)
+		if err != nil {
+			return fmt.Errorf("path element %d: invalid successor peer id: %w", i, err)
+		}
+
+		if predecessor != expectedPredecessor {
+			return fmt.Errorf("path element %d: out-of-order hop, expected predecessor %s, got %s", i, expectedPredecessor, predecessor)
+		}
+		if elem.Timestamp < lastTimestamp {
+			return fmt.Errorf("path element %d: timestamp moves backward", i)
+		}
+
+		pubKey, err := pubKeyOf(predecessor)
+		if err != nil {
+			return fmt.Errorf("path element %d: unknown peer %s: %w", i, predecessor, err)
+		}
+
+		ok, err := pubKey.Verify(pathElementSigningBytes(predecessor, successor, elem.Timestamp), elem.Signature)
+		if err != nil {
+			return fmt.Errorf("path element %d: signature verification error: %w", i, err)
+		}
+		if !ok {
+			return fmt.Errorf("path element %d: signature does not match peer %s", i, predecessor)
+		}
+
+		expectedPredecessor = successor
+		lastTimestamp = elem.Timestamp
+	}
+
+	if expectedPredecessor != terminalPeer {
+		return fmt.Errorf("holder path terminates at %s, expected %s", expectedPredecessor, terminalPeer)
+	}
+
+	return nil
+}
+
+// pubKeyFromPeerstore is the default pubKeyOf used by VerifyHolderPath: it
+// looks the key up in the host's peerstore, which identify populates for
+// any peer we've connected to.
+func pubKeyFromPeerstore(ps peerstore.Peerstore) func(peer.ID) (crypto.PubKey, error) {
+	return func(p peer.ID) (crypto.PubKey, error) {
+		pub := ps.PubKey(p)
+		if pub == nil {
+			return nil, fmt.Errorf("no public key known for peer %s", p)
+		}
+		return pub, nil
+	}
+}
+
+// registerHoldersProtocolHandler wires up the /orcanet/market/holders/1.0.0
+// handler: for each incoming HolderPathQuery, it looks up the closest peers
+// to the file's key and relays the query to the first one it hasn't already
+// seen in the path, appending its own signed PathElement before returning
+// the response upstream. Only when every such peer has been seen does it
+// answer directly from the local DHT client; it does not compare its own
+// distance to the key against theirs.
+func registerHoldersProtocolHandler(h host.Host, d *dht.IpfsDHT, priv crypto.PrivKey) {
+	h.SetStreamHandler(holdersProtocolID, func(s network.Stream) {
+		defer s.Close()
+
+		reader := protoio.NewDelimitedReader(s, network.MessageSizeMax)
+		writer := protoio.NewDelimitedWriter(s)
+
+		var query pb.HolderPathQuery
+		if err := reader.ReadMsg(&query); err != nil {
+			s.Reset()
+			return
+		}
+
+		resp, err := handleHolderPathQuery(h, d, priv, &query)
+		if err != nil {
+			s.Reset()
+			return
+		}
+
+		if err := writer.WriteMsg(resp); err != nil {
+			s.Reset()
+		}
+	})
+}
+
+// handleHolderPathQuery resolves one hop of a holder lookup: it forwards
+// the query (with this hop's signed PathElement appended) to the closest
+// peer to the file's CID not already in the path, and answers from the DHT
+// client only when no such peer is left.
+func handleHolderPathQuery(h host.Host, d *dht.IpfsDHT, priv crypto.PrivKey, query *pb.HolderPathQuery) (*pb.HoldersResponse, error) {
+	if len(query.Path) >= holderPathMaxHops {
+		return nil, fmt.Errorf("holder path exceeded %d hops", holderPathMaxHops)
+	}
+
+	// Derive this hop's context from the deadline the originating caller
+	// stamped onto the query rather than starting a fresh
+	// findProvidersTimeout here: that way a caller's cancellation (or a
+	// deadline close to expiring) bounds every hop of the relay instead of
+	// each hop getting its own independent budget.
+	deadline := time.Unix(0, query.DeadlineUnixNano)
+	if query.DeadlineUnixNano == 0 {
+		deadline = time.Now().Add(findProvidersTimeout)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	c, err := fileCID(query.FileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search the same keyspace Provide/FindProvidersAsync key off of (the
+	// CID's multihash), not the raw hex file hash string, or "closest
+	// peers" here has no relation to who holds provider records for it.
+	closest, err := d.GetClosestPeers(ctx, string(c.Hash()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find closest peers for %s: %w", query.FileHash, err)
+	}
+
+	visited := map[peer.ID]bool{h.ID(): true}
+	for _, elem := range query.Path {
+		if pid, err := peer.Decode(elem.PredecessorPeerId); err == nil {
+			visited[pid] = true
+		}
+	}
+
+	var next peer.ID
+	for _, p := range closest {
+		if !visited[p] {
+			next = p
+			break
+		}
+	}
+
+	if next == "" {
+		// No unvisited peer left to hop to: this node is the terminus,
+		// answer from the local DHT client. The accumulated path from
+		// every ancestor hop travels back upward unchanged.
+		resp, err := checkHoldersLocal(ctx, d, &pb.CheckHoldersRequest{FileHash: query.FileHash}, streamProviderLimit)
+		if err != nil {
+			return nil, err
+		}
+		resp.Path = query.Path
+		return resp, nil
+	}
+
+	elem, err := signPathElement(priv, next, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	// Append this hop's element to the path in forward (oldest-first)
+	// order before relaying; the terminus returns this same slice
+	// untouched, so no hop needs to (re-)append on the way back up. The
+	// deadline carries forward unchanged so every hop shares the same
+	// absolute budget as the originating caller.
+	forwarded := &pb.HolderPathQuery{
+		FileHash:         query.FileHash,
+		Path:             append(append([]*pb.PathElement{}, query.Path...), elem),
+		DeadlineUnixNano: query.DeadlineUnixNano,
+	}
+
+	stream, err := h.NewStream(ctx, next, holdersProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holders stream to %s: %w", next, err)
+	}
+	defer stream.Close()
+
+	writer := protoio.NewDelimitedWriter(stream)
+	if err := writer.WriteMsg(forwarded); err != nil {
+		return nil, fmt.Errorf("failed to forward holder query to %s: %w", next, err)
+	}
+
+	reader := protoio.NewDelimitedReader(stream, network.MessageSizeMax)
+	var resp pb.HoldersResponse
+	if err := reader.ReadMsg(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read holder response from %s: %w", next, err)
+	}
+
+	return &resp, nil
+}
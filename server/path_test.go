@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	pb "orcanet/market"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func generateTestPeer(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("derive peer id: %v", err)
+	}
+	return priv, pid
+}
+
+func TestVerifyHolderPathTwoHopChain(t *testing.T) {
+	privP0, p0 := generateTestPeer(t)
+	privP1, p1 := generateTestPeer(t)
+	_, p2 := generateTestPeer(t)
+
+	pubKeys := map[peer.ID]crypto.PubKey{
+		p0: privP0.GetPublic(),
+		p1: privP1.GetPublic(),
+	}
+	pubKeyOf := func(p peer.ID) (crypto.PubKey, error) {
+		pub, ok := pubKeys[p]
+		if !ok {
+			return nil, errors.New("unknown peer")
+		}
+		return pub, nil
+	}
+
+	elem01, err := signPathElement(privP0, p1, 1)
+	if err != nil {
+		t.Fatalf("sign elem01: %v", err)
+	}
+	elem12, err := signPathElement(privP1, p2, 2)
+	if err != nil {
+		t.Fatalf("sign elem12: %v", err)
+	}
+
+	// Oldest-first ordering, as handleHolderPathQuery now builds it: the
+	// chain O->P1->P2 is reported as [elem01, elem12].
+	if err := VerifyHolderPath([]*pb.PathElement{elem01, elem12}, p0, p2, pubKeyOf); err != nil {
+		t.Fatalf("expected valid chain to verify, got: %v", err)
+	}
+
+	// The reversed order is what handleHolderPathQuery used to return
+	// before being fixed; VerifyHolderPath must reject it since path[0]'s
+	// predecessor (P1) doesn't match originPeer (P0).
+	if err := VerifyHolderPath([]*pb.PathElement{elem12, elem01}, p0, p2, pubKeyOf); err == nil {
+		t.Fatalf("expected reversed chain to fail verification")
+	}
+
+	// Tampering with a signed field must invalidate the signature.
+	tampered := &pb.PathElement{
+		PredecessorPeerId: elem01.PredecessorPeerId,
+		SuccessorPeerId:   elem01.SuccessorPeerId,
+		Timestamp:         elem01.Timestamp + 1,
+		Signature:         elem01.Signature,
+	}
+	if err := VerifyHolderPath([]*pb.PathElement{tampered, elem12}, p0, p2, pubKeyOf); err == nil {
+		t.Fatalf("expected tampered element to fail verification")
+	}
+
+	// Wrong terminus must be rejected even if the chain itself is valid.
+	if err := VerifyHolderPath([]*pb.PathElement{elem01, elem12}, p0, p1, pubKeyOf); err == nil {
+		t.Fatalf("expected mismatched terminus to fail verification")
+	}
+
+	// A reference to an unknown peer must be rejected.
+	if err := VerifyHolderPath([]*pb.PathElement{elem01, elem12}, p0, p2, func(peer.ID) (crypto.PubKey, error) {
+		return nil, errors.New("no such peer")
+	}); err == nil {
+		t.Fatalf("expected unknown peer to fail verification")
+	}
+
+	// An empty path is never valid.
+	if err := VerifyHolderPath(nil, p0, p2, pubKeyOf); err == nil {
+		t.Fatalf("expected empty path to fail verification")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// reprovideInterval is how often MarketService re-announces every
+// registered file to the DHT. Provider records expire after ~24h in
+// go-libp2p-kad-dht, so re-announcing well before that keeps holders
+// discoverable without flooding the network with puts.
+const reprovideInterval = 12 * time.Hour
+
+// MarketService owns the long-lived state that registerFile/checkHolders
+// used to operate on as naked free functions against a bare *dht.IpfsDHT:
+// the host, the DHT handle, the registry of files this node has announced,
+// and the context that governs the reprovide and address-watch goroutines.
+// registry is the single source of truth for "what has this node
+// registered" — both the reprovide ticker and the address-change watcher
+// read from it, instead of each keeping its own copy.
+type MarketService struct {
+	host host.Host
+	dht  *dht.IpfsDHT
+	priv crypto.PrivKey
+
+	registryMu sync.Mutex
+	registry   map[string]struct{} // file hashes registered by this node
+
+	cancel context.CancelFunc
+}
+
+// NewMarketService creates a MarketService bound to h and d, starts the
+// reprovide loop, and subscribes to EvtLocalAddressesUpdated so that a NAT
+// rebind, relay change, or interface flap re-announces every
+// locally-registered file with fresh addresses instead of leaving stale
+// multiaddrs in the DHT until the next manual RegisterFile call.
+func NewMarketService(ctx context.Context, h host.Host, d *dht.IpfsDHT, priv crypto.PrivKey) (*MarketService, error) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to address updates: %w", err)
+	}
+
+	svcCtx, cancel := context.WithCancel(ctx)
+	svc := &MarketService{
+		host:     h,
+		dht:      d,
+		priv:     priv,
+		registry: map[string]struct{}{},
+		cancel:   cancel,
+	}
+
+	go svc.watchAddressChanges(svcCtx, sub)
+	go svc.reprovideLoop(svcCtx)
+	registerHoldersProtocolHandler(h, d, priv)
+
+	return svc, nil
+}
+
+// RegisterFile registers fileHash as held by the local peer and records it
+// in the service's registry so it's re-announced on both the reprovide
+// ticker and any future address change.
+func (s *MarketService) RegisterFile(ctx context.Context, fileHash string) error {
+	if err := registerFile(ctx, s.dht, s.priv, fileHash, s.host.Addrs()); err != nil {
+		return err
+	}
+
+	s.registryMu.Lock()
+	s.registry[fileHash] = struct{}{}
+	s.registryMu.Unlock()
+	return nil
+}
+
+// watchAddressChanges re-announces every locally-registered file whenever
+// the host's listen addresses change, so remote checkHolders calls stop
+// handing out multiaddrs the local peer can no longer be reached at.
+func (s *MarketService) watchAddressChanges(ctx context.Context, sub event.Subscription) {
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			addrUpdate, ok := evt.(event.EvtLocalAddressesUpdated)
+			if !ok {
+				continue
+			}
+			if !hasAddedAddress(addrUpdate.Current) && len(addrUpdate.Removed) == 0 {
+				continue
+			}
+			s.reannounceAll(ctx)
+		}
+	}
+}
+
+// hasAddedAddress reports whether current includes an address that was
+// just added, i.e. event.EvtLocalAddressesUpdated.Current contains an
+// UpdatedAddress whose Action is event.Added.
+func hasAddedAddress(current []event.UpdatedAddress) bool {
+	for _, addr := range current {
+		if addr.Action == event.Added {
+			return true
+		}
+	}
+	return false
+}
+
+// reannounceAll re-seals and re-puts the MarketFileRecord for every
+// locally-registered file using the host's current addresses. Each
+// envelope carries a fresh, monotonically-increasing Seq (registerFile
+// passes the current UnixNano timestamp) so it beats the previous record
+// under MarketValidator.Select.
+func (s *MarketService) reannounceAll(ctx context.Context) {
+	addrs := s.host.Addrs()
+	for _, hash := range s.registeredHashes() {
+		if err := registerFile(ctx, s.dht, s.priv, hash, addrs); err != nil {
+			fmt.Printf("failed to re-announce file %s after address change: %v\n", hash, err)
+		}
+	}
+}
+
+// reprovideLoop periodically re-announces every file in the registry so
+// its provider record doesn't lapse before the DHT's expiry window, and
+// re-seals its MarketFileRecord so the signed attestation corroborateHolder
+// relies on doesn't expire out from under a holder whose addresses never
+// change. This follows the same re-provide pattern used by go-ipfs: a
+// long-lived ticker goroutine that walks the registry and re-registers
+// each entry. It returns when ctx is cancelled.
+func (s *MarketService) reprovideLoop(ctx context.Context) {
+	ticker := time.NewTicker(reprovideInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			addrs := s.host.Addrs()
+			for _, hash := range s.registeredHashes() {
+				if err := registerFile(ctx, s.dht, s.priv, hash, addrs); err != nil {
+					fmt.Printf("failed to reprovide %s: %v\n", hash, err)
+				}
+			}
+		}
+	}
+}
+
+// registeredHashes returns a snapshot of the file hashes this node has
+// registered, safe to range over without holding registryMu.
+func (s *MarketService) registeredHashes() []string {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	hashes := make([]string, 0, len(s.registry))
+	for hash := range s.registry {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// Close stops the reprovide loop and the address-change watcher owned by
+// this service.
+func (s *MarketService) Close() {
+	s.cancel()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	pb "orcanet/market"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+)
+
+// streamProviderLimit caps how many holders a single CheckHoldersAsync call
+// will ask the DHT for; clients that want more page through additional
+// calls, carrying their accumulated seen_filter forward.
+const streamProviderLimit = 100
+
+// seenFilterN/seenFilterFP size the bloom filter built for a fresh
+// CheckHoldersAsync call when the client doesn't supply one of its own.
+const (
+	seenFilterN  = 1024
+	seenFilterFP = 0.01
+)
+
+// marketServer implements the streaming half of pb.MarketServer against a
+// live DHT. It's kept separate from the registerFile/checkHolders free
+// functions in dht.go, which remain usable on their own for the unary RPCs.
+type marketServer struct {
+	pb.UnimplementedMarketServer
+	dht *dht.IpfsDHT
+}
+
+// CheckHoldersAsync streams every holder discovered for a file as the DHT
+// walk surfaces it, instead of blocking for the whole FindProviders walk
+// like checkHolders does. A bloom filter of peer IDs already reported,
+// carried in req.SeenFilter, keeps duplicate provider hits from multiple
+// DHT replicas from being streamed twice without needing an unbounded
+// seen-set; the client is expected to OR newly-seen peer IDs into its
+// filter before the next paginated call.
+func (s *marketServer) CheckHoldersAsync(req *pb.CheckHoldersRequest, stream pb.Market_CheckHoldersAsyncServer) error {
+	c, err := fileCID(req.FileHash)
+	if err != nil {
+		return err
+	}
+
+	seen, err := loadSeenFilter(req.SeenFilter)
+	if err != nil {
+		return fmt.Errorf("invalid seen_filter: %w", err)
+	}
+
+	// Derive from the stream's context so that closing the stream, or the
+	// RPC's ctx firing, cancels the underlying DHT walk instead of letting
+	// it run to completion in the background.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	for addrInfo := range s.dht.FindProvidersAsync(ctx, c, streamProviderLimit) {
+		if seen.TestString(string(addrInfo.ID)) {
+			continue
+		}
+		seen.AddString(string(addrInfo.ID))
+
+		rec, err := corroborateHolder(ctx, s.dht, req.FileHash, addrInfo.ID)
+		if err != nil {
+			continue
+		}
+
+		if err := stream.Send(&pb.PeerInfo{
+			PeerId: rec.PeerID.String(),
+			Addrs:  convertAddrsToStrings(addrInfo.Addrs),
+		}); err != nil {
+			return fmt.Errorf("failed to stream holder for file hash %s: %w", req.FileHash, err)
+		}
+	}
+
+	return nil
+}
+
+// loadSeenFilter deserializes a client-supplied bloom filter, or builds a
+// fresh one sized for ~seenFilterN peers at seenFilterFP false positive
+// rate if none was supplied, e.g. on the first page of a paginated walk.
+func loadSeenFilter(data []byte) (*bloom.BloomFilter, error) {
+	if len(data) == 0 {
+		return bloom.NewWithEstimates(seenFilterN, seenFilterFP), nil
+	}
+
+	filter := &bloom.BloomFilter{}
+	if _, err := filter.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to decode seen_filter: %w", err)
+	}
+	return filter, nil
+}
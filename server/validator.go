@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "orcanet/market"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	drecord "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/multiformats/go-multiaddr"
+	"google.golang.org/protobuf/proto"
+)
+
+// marketFileRecordDomain is the domain string used to seal and consume
+// MarketFileRecord envelopes. Sealing/consuming under a dedicated domain
+// (rather than reusing peer.PeerRecord's) keeps a market file attestation
+// from being replayed as a generic peer record, or vice versa.
+const marketFileRecordDomain = "orcanet-market-file-holder"
+
+// marketFileRecordCodec is the envelope's PayloadType multicodec prefix.
+// It's an arbitrary private-use value; it only needs to be stable and
+// unique among the payload types this node seals.
+var marketFileRecordCodec = []byte{0x91, 0x02}
+
+// MarketFileRecord is the payload sealed inside a record.Envelope that
+// PutValue stores under "/market/<fileHash>/<peerID>" (see
+// marketFileRecordKey). It lets a holder attest to
+// its own addresses and a monotonic sequence number, signed with its
+// libp2p private key, so MarketValidator can tell a genuine
+// re-announcement from a forged or replayed one.
+type MarketFileRecord struct {
+	PeerID   peer.ID
+	Addrs    []multiaddr.Multiaddr
+	Expiry   time.Time
+	FileHash string
+	Seq      uint64
+}
+
+// Domain implements record.Record.
+func (r *MarketFileRecord) Domain() string { return marketFileRecordDomain }
+
+// Codec implements record.Record.
+func (r *MarketFileRecord) Codec() []byte { return marketFileRecordCodec }
+
+// MarshalRecord implements record.Record.
+func (r *MarketFileRecord) MarshalRecord() ([]byte, error) {
+	addrs := make([]string, len(r.Addrs))
+	for i, a := range r.Addrs {
+		addrs[i] = a.String()
+	}
+
+	return proto.Marshal(&pb.MarketFileRecord{
+		PeerId:   r.PeerID.String(),
+		Addrs:    addrs,
+		Expiry:   r.Expiry.Unix(),
+		FileHash: r.FileHash,
+		Seq:      r.Seq,
+	})
+}
+
+// UnmarshalRecord implements record.Record.
+func (r *MarketFileRecord) UnmarshalRecord(data []byte) error {
+	var msg pb.MarketFileRecord
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("failed to unmarshal MarketFileRecord: %w", err)
+	}
+
+	pid, err := peer.Decode(msg.PeerId)
+	if err != nil {
+		return fmt.Errorf("invalid peer id in MarketFileRecord: %w", err)
+	}
+
+	addrs := make([]multiaddr.Multiaddr, 0, len(msg.Addrs))
+	for _, s := range msg.Addrs {
+		a, err := multiaddr.NewMultiaddr(s)
+		if err != nil {
+			return fmt.Errorf("invalid addr in MarketFileRecord: %w", err)
+		}
+		addrs = append(addrs, a)
+	}
+
+	r.PeerID = pid
+	r.Addrs = addrs
+	r.Expiry = time.Unix(msg.Expiry, 0)
+	r.FileHash = msg.FileHash
+	r.Seq = msg.Seq
+	return nil
+}
+
+// sealFileRecord builds and signs a MarketFileRecord envelope attesting
+// that the peer owning priv holds fileHash at addrs until ttl elapses.
+func sealFileRecord(priv crypto.PrivKey, fileHash string, addrs []multiaddr.Multiaddr, ttl time.Duration, seq uint64) (*record.Envelope, error) {
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive peer id from private key: %w", err)
+	}
+
+	rec := &MarketFileRecord{
+		PeerID:   pid,
+		Addrs:    addrs,
+		Expiry:   time.Now().Add(ttl),
+		FileHash: fileHash,
+		Seq:      seq,
+	}
+
+	env, err := record.Seal(rec, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal MarketFileRecord: %w", err)
+	}
+	return env, nil
+}
+
+// MarketValidator is a drecord.Validator for keys under the DHT's "market"
+// namespace. It rejects anything that isn't a validly-signed, unexpired
+// MarketFileRecord whose embedded FileHash matches the key, and prefers the
+// record with the highest Seq so a later re-announcement wins over a
+// stale one.
+type MarketValidator struct{}
+
+// Validate implements drecord.Validator. key is either the full DHT key
+// "/market/<fileHash>/<peerID>", as NamespacedValidator passes it, or the
+// same key with the "/market/" prefix already stripped.
+// Each holder puts its MarketFileRecord under its own key suffix so that
+// fetching one holder's record never shadows another's the way a single
+// shared "<fileHash>" key would under Select.
+func (MarketValidator) Validate(key string, value []byte) error {
+	var rec MarketFileRecord
+	envelope, err := record.ConsumeTypedEnvelope(value, &rec)
+	if err != nil {
+		return fmt.Errorf("invalid market file record: %w", err)
+	}
+
+	signer, err := peer.IDFromPublicKey(envelope.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid envelope public key: %w", err)
+	}
+	if signer != rec.PeerID {
+		return errors.New("market file record signer does not match embedded peer id")
+	}
+
+	if time.Now().After(rec.Expiry) {
+		return errors.New("market file record has expired")
+	}
+
+	fileHash, peerID, ok := strings.Cut(strings.TrimPrefix(key, "/market/"), "/")
+	if !ok {
+		return errors.New("malformed market file record key, expected <fileHash>/<peerID>")
+	}
+	if rec.FileHash != fileHash {
+		return errors.New("market file record file hash does not match key")
+	}
+	if rec.PeerID.String() != peerID {
+		return errors.New("market file record peer id does not match key")
+	}
+
+	return nil
+}
+
+// Select implements drecord.Validator, preferring the record with the
+// highest Seq. Values that fail to parse are ignored; if none parse it
+// returns an error, matching the other Select implementations in
+// go-libp2p-record.
+func (MarketValidator) Select(key string, values [][]byte) (int, error) {
+	best := -1
+	var bestSeq uint64
+
+	for i, v := range values {
+		var rec MarketFileRecord
+		if _, err := record.ConsumeTypedEnvelope(v, &rec); err != nil {
+			continue
+		}
+		if best == -1 || rec.Seq > bestSeq {
+			best = i
+			bestSeq = rec.Seq
+		}
+	}
+
+	if best == -1 {
+		return -1, errors.New("no valid market file records to select from")
+	}
+	return best, nil
+}
+
+// newMarketValidator returns the namespaced validator to pass to
+// dht.New(..., dht.Validator(newMarketValidator())) so "/market/..." keys
+// are checked by MarketValidator instead of being accepted unconditionally.
+func newMarketValidator() drecord.NamespacedValidator {
+	return drecord.NamespacedValidator{
+		"market": MarketValidator{},
+	}
+}
+
+// marketFileRecordKey builds the DHT key a holder's MarketFileRecord for
+// fileHash is stored under: one key per (fileHash, holder) pair, so that
+// fetching one holder's attestation can never shadow another's.
+func marketFileRecordKey(fileHash string, p peer.ID) string {
+	return fmt.Sprintf("/market/%s/%s", fileHash, p.String())
+}
+
+// corroborateHolder fetches and validates the MarketFileRecord a holder
+// put under marketFileRecordKey(fileHash, p). checkHolders uses this to
+// drop provider-record hits that aren't backed by an authentic,
+// unexpired attestation, so a peer that merely announces itself as a
+// provider without ever registering a valid record can't poison holder
+// lookups.
+func corroborateHolder(ctx context.Context, d *dht.IpfsDHT, fileHash string, p peer.ID) (*MarketFileRecord, error) {
+	key := marketFileRecordKey(fileHash, p)
+
+	data, err := d.GetValue(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("no market file record for peer %s: %w", p, err)
+	}
+
+	if err := (MarketValidator{}).Validate(key[len("/market/"):], data); err != nil {
+		return nil, err
+	}
+
+	var rec MarketFileRecord
+	if _, err := record.ConsumeTypedEnvelope(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal market file record for peer %s: %w", p, err)
+	}
+	return &rec, nil
+}
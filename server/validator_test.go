@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func sealTestRecord(t *testing.T, rec *MarketFileRecord, signer crypto.PrivKey) []byte {
+	t.Helper()
+
+	env, err := record.Seal(rec, signer)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	return data
+}
+
+func TestMarketValidatorValidate(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("derive peer id: %v", err)
+	}
+	otherPriv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate other key: %v", err)
+	}
+	addr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	if err != nil {
+		t.Fatalf("parse addr: %v", err)
+	}
+
+	validRec := &MarketFileRecord{
+		PeerID:   pid,
+		Addrs:    []multiaddr.Multiaddr{addr},
+		Expiry:   time.Now().Add(time.Hour),
+		FileHash: "deadbeef",
+		Seq:      1,
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		value   []byte
+		wantErr bool
+	}{
+		{
+			name:  "valid record",
+			key:   "deadbeef/" + pid.String(),
+			value: sealTestRecord(t, validRec, priv),
+		},
+		{
+			name: "expired",
+			key:  "deadbeef/" + pid.String(),
+			value: sealTestRecord(t, &MarketFileRecord{
+				PeerID: pid, Addrs: validRec.Addrs, Expiry: time.Now().Add(-time.Hour),
+				FileHash: "deadbeef", Seq: 1,
+			}, priv),
+			wantErr: true,
+		},
+		{
+			name:    "file hash does not match key",
+			key:     "otherhash/" + pid.String(),
+			value:   sealTestRecord(t, validRec, priv),
+			wantErr: true,
+		},
+		{
+			name:    "peer id does not match key",
+			key:     "deadbeef/" + "not-the-right-peer-id",
+			value:   sealTestRecord(t, validRec, priv),
+			wantErr: true,
+		},
+		{
+			name: "signer does not match embedded peer id",
+			key:  "deadbeef/" + pid.String(),
+			// sealed by otherPriv, but the payload still claims pid.
+			value:   sealTestRecord(t, validRec, otherPriv),
+			wantErr: true,
+		},
+		{
+			name:    "malformed key",
+			key:     "deadbeef",
+			value:   sealTestRecord(t, validRec, priv),
+			wantErr: true,
+		},
+		{
+			name:    "corrupt envelope",
+			key:     "deadbeef/" + pid.String(),
+			value:   append(sealTestRecord(t, validRec, priv), 0xFF),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (MarketValidator{}).Validate(tt.key, tt.value)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMarketValidatorSelectPrefersHighestSeq(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("derive peer id: %v", err)
+	}
+
+	seal := func(seq uint64) []byte {
+		return sealTestRecord(t, &MarketFileRecord{
+			PeerID:   pid,
+			Expiry:   time.Now().Add(time.Hour),
+			FileHash: "deadbeef",
+			Seq:      seq,
+		}, priv)
+	}
+
+	values := [][]byte{seal(1), seal(5), seal(3)}
+	idx, err := (MarketValidator{}).Select("deadbeef/"+pid.String(), values)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if idx != 1 {
+		t.Fatalf("expected index 1 (seq=5), got %d", idx)
+	}
+}